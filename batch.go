@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// PutLogEvents service limits. See the CloudWatch Logs API reference.
+const (
+	maxBatchEvents = 10000
+	maxBatchBytes  = 1048576
+	maxBatchSpanMs = int64(24 * time.Hour / time.Millisecond)
+	maxEventAgeMs  = int64(14 * 24 * time.Hour / time.Millisecond)
+	maxEventAhead  = int64(2 * time.Hour / time.Millisecond)
+)
+
+// buildBatch selects a PutLogEvents-legal, ascending-by-timestamp prefix of
+// events: at most maxBatchEvents/maxBatchBytes, and spanning no more than
+// maxBatchSpanMs between its oldest and newest timestamp. Events outside the
+// service's accepted time window are skipped (and counted in dropped)
+// instead of blocking the rest of the batch. consumed is the number of
+// leading events from the (sorted) input that were either included or
+// dropped, so the caller knows how far it can advance past them.
+//
+// The sort must be stable and match the one eventQueue.getBatch applies to
+// the segment before calling in: consumed is later used by eventQueue.commit
+// to advance a position into that same segment, so if the two orderings ever
+// disagreed, commit would advance past the wrong events (some committed
+// without ever being uploaded, others re-uploaded as duplicates).
+func buildBatch(events eventsList, dropped *int64) (batch eventsList, consumed int) {
+	sorted := make(eventsList, len(events))
+	copy(sorted, events)
+	sort.Stable(sorted)
+
+	nowMs := time.Now().UnixNano() / int64(time.Millisecond)
+	minTs := nowMs - maxEventAgeMs
+	maxTs := nowMs + maxEventAhead
+
+	var bytes int
+	var oldest int64
+	for _, e := range sorted {
+		if e.timestamp < minTs || e.timestamp > maxTs {
+			log.Warnf("dropping event outside PutLogEvents accepted window (timestamp %d)", e.timestamp)
+			atomic.AddInt64(dropped, 1)
+			consumed++
+			continue
+		}
+		if len(batch) == 0 {
+			oldest = e.timestamp
+		} else if e.timestamp-oldest > maxBatchSpanMs {
+			break
+		}
+		if len(batch)+1 > maxBatchEvents || bytes+e.size() > maxBatchBytes {
+			break
+		}
+		batch = append(batch, e)
+		bytes += e.size()
+		consumed++
+	}
+	return
+}
+
+// tokenBucket rate-limits PutLogEvents calls to the documented per-stream
+// cap (5/s) without blocking anyone but the caller of Wait.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	tokens float64
+	max    float64
+	last   time.Time
+}
+
+func newTokenBucket(ratePerSecond float64) *tokenBucket {
+	return &tokenBucket{rate: ratePerSecond, tokens: ratePerSecond, max: ratePerSecond, last: time.Now()}
+}
+
+// Wait blocks until a token is available and consumes it.
+func (b *tokenBucket) Wait() {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens = math.Min(b.max, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+		time.Sleep(wait)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func nowMs() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+func TestBuildBatchOrdersAscending(t *testing.T) {
+	var dropped int64
+	now := nowMs()
+	events := eventsList{
+		{msg: "b", timestamp: now - 100},
+		{msg: "a", timestamp: now - 200},
+		{msg: "c", timestamp: now},
+	}
+
+	batch, consumed := buildBatch(events, &dropped)
+	if consumed != 3 || len(batch) != 3 {
+		t.Fatalf("expected all 3 events consumed, got %d/%d", consumed, len(batch))
+	}
+	if batch[0].msg != "a" || batch[1].msg != "b" || batch[2].msg != "c" {
+		t.Fatalf("batch not sorted ascending: %+v", batch)
+	}
+}
+
+func TestBuildBatchDropsEventsOutsideAcceptedWindow(t *testing.T) {
+	var dropped int64
+	now := nowMs()
+	events := eventsList{
+		{msg: "too-old", timestamp: now - maxEventAgeMs - 1000},
+		{msg: "ok", timestamp: now},
+	}
+
+	batch, consumed := buildBatch(events, &dropped)
+	if len(batch) != 1 || batch[0].msg != "ok" {
+		t.Fatalf("expected only the in-window event in the batch, got %+v", batch)
+	}
+	if consumed != 2 {
+		t.Fatalf("expected both events consumed (1 dropped, 1 batched), got %d", consumed)
+	}
+	if dropped != 1 {
+		t.Fatalf("expected the dropped counter to be 1, got %d", dropped)
+	}
+}
+
+func TestBuildBatchStopsAtMaxEvents(t *testing.T) {
+	var dropped int64
+	now := nowMs()
+	events := make(eventsList, maxBatchEvents+5)
+	for i := range events {
+		events[i] = logEvent{msg: "x", timestamp: now + int64(i)}
+	}
+
+	batch, consumed := buildBatch(events, &dropped)
+	if len(batch) != maxBatchEvents || consumed != maxBatchEvents {
+		t.Fatalf("expected batch capped at %d events, got %d/%d", maxBatchEvents, len(batch), consumed)
+	}
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"sort"
 	"testing"
-	"time"
 )
 
 func TestMessageSorting(t *testing.T) {
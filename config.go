@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/go-ini/ini"
+)
+
+// defaultSpoolBase is where a flow's on-disk spool lives when neither the
+// flow nor the [main] section set spool_dir.
+const defaultSpoolBase = "/var/spool/logs_agent"
+
+// upload_delay is the number of milliseconds between upload attempts for a
+// flow, read straight off the ini value.
+type upload_delay int
+
+const (
+	defaultUploadDelay upload_delay = 5000
+	defaultQueueSize                = 10000
+)
+
+// MainCfg holds the process-wide settings from the [main] section.
+type MainCfg struct {
+	LogOutput string
+	LogLevel  string
+}
+
+// MetricsCfg holds the optional [metrics] section that exposes a Prometheus
+// scrape endpoint. Enabled is false unless the section sets a listen address.
+type MetricsCfg struct {
+	Enabled bool
+	Listen  string
+	Path    string
+}
+
+// FlowCfg describes one syslog-to-cloudwatch pipeline, i.e. one [flow.*]
+// section of the ini file.
+type FlowCfg struct {
+	Name             string
+	Source           string
+	SyslogFormat     string
+	CloudwatchFormat string
+	Group            string
+	Stream           string
+	QueueSize        int
+	UploadDelay      upload_delay
+
+	// SpoolDir holds the flow's on-disk event spool, used as a crash-durable
+	// queue in front of uploads.
+	SpoolDir string
+
+	// MultilinePattern, when set, marks the first line of a new logical
+	// event; records up to the next match are coalesced into one logEvent.
+	MultilinePattern  string
+	MultilineTimeout  time.Duration
+	MultilineMaxLines int
+}
+
+// IniConfig wraps the parsed config file and exposes the typed sections the
+// rest of the agent cares about.
+type IniConfig struct {
+	file *ini.File
+	path string
+}
+
+func NewIniConfig(path string) *IniConfig {
+	file, err := ini.Load(path)
+	if err != nil {
+		file = ini.Empty()
+	}
+	return &IniConfig{file: file, path: path}
+}
+
+// Validate makes sure the config file parsed and declares at least one flow.
+func (c *IniConfig) Validate() error {
+	if len(c.file.Section("").Keys()) == 0 && len(c.file.Sections()) <= 1 {
+		return fmt.Errorf("%s: no sections found", c.path)
+	}
+	if len(c.GetFlows()) == 0 {
+		return fmt.Errorf("%s: no [flow.*] sections found", c.path)
+	}
+	return nil
+}
+
+func (c *IniConfig) GetMain() MainCfg {
+	sec := c.file.Section("main")
+	return MainCfg{
+		LogOutput: sec.Key("log_output").MustString("stderr"),
+		LogLevel:  sec.Key("log_level").MustString("error"),
+	}
+}
+
+// GetMetrics reads the optional [metrics] section. The endpoint is disabled
+// unless listen is set, so an agent with no such section behaves exactly as
+// it did before metrics existed.
+func (c *IniConfig) GetMetrics() MetricsCfg {
+	sec := c.file.Section("metrics")
+	listen := sec.Key("listen").String()
+	return MetricsCfg{
+		Enabled: listen != "",
+		Listen:  listen,
+		Path:    sec.Key("path").MustString("/metrics"),
+	}
+}
+
+// mustDuration parses a duration string from the ini file, falling back to
+// 0 (the caller's default) if it is malformed rather than aborting startup.
+func mustDuration(s string) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		log.Errorf("invalid duration %q: %v", s, err)
+		return 0
+	}
+	return d
+}
+
+func (c *IniConfig) GetFlows() (flows []*FlowCfg) {
+	spoolBase := c.file.Section("main").Key("spool_dir").MustString(defaultSpoolBase)
+	for _, sec := range c.file.Sections() {
+		if !strings.HasPrefix(sec.Name(), "flow.") {
+			continue
+		}
+		name := strings.TrimPrefix(sec.Name(), "flow.")
+		flows = append(flows, &FlowCfg{
+			Name:             name,
+			Source:           sec.Key("source").String(),
+			SyslogFormat:     sec.Key("syslog_format").MustString("rfc3164"),
+			CloudwatchFormat: sec.Key("cloudwatch_format").MustString("{{.Message}}"),
+			Group:            sec.Key("group").String(),
+			Stream:           sec.Key("stream").String(),
+			QueueSize:        sec.Key("queue_size").MustInt(defaultQueueSize),
+			UploadDelay:      upload_delay(sec.Key("upload_delay").MustInt(int(defaultUploadDelay))),
+			SpoolDir:         sec.Key("spool_dir").MustString(filepath.Join(spoolBase, name)),
+
+			MultilinePattern:  sec.Key("multiline_pattern").String(),
+			MultilineTimeout:  mustDuration(sec.Key("multiline_timeout").MustString("500ms")),
+			MultilineMaxLines: sec.Key("multiline_max_lines").MustInt(500),
+		})
+	}
+	return
+}
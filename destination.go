@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// putLogEventsRatePerStream is the documented CloudWatch Logs PutLogEvents
+// cap of 5 requests per second per log stream.
+const putLogEventsRatePerStream = 5
+
+// destination is one cloudwatch log group/stream pair that a flow (or, once
+// streams are templated per-record, a single flow's sub-stream) uploads to.
+type destination struct {
+	group   string
+	stream  string
+	token   *string
+	limiter *tokenBucket
+}
+
+func newDestination(stream, group string) *destination {
+	return &destination{group: group, stream: stream, limiter: newTokenBucket(putLogEventsRatePerStream)}
+}
+
+func (d *destination) String() string {
+	return fmt.Sprintf("group: %s stream: %s", d.group, d.stream)
+}
+
+func (d *destination) upload(batch eventsList) error {
+	events := make([]*cloudwatchlogs.InputLogEvent, len(batch))
+	for i, e := range batch {
+		events[i] = &cloudwatchlogs.InputLogEvent{
+			Message:   aws.String(e.msg),
+			Timestamp: aws.Int64(e.timestamp),
+		}
+	}
+	out, err := cwlogs.PutLogEvents(&cloudwatchlogs.PutLogEventsInput{
+		LogGroupName:  aws.String(d.group),
+		LogStreamName: aws.String(d.stream),
+		LogEvents:     events,
+		SequenceToken: d.token,
+	})
+	if err != nil {
+		return err
+	}
+	d.token = out.NextSequenceToken
+	return nil
+}
+
+// create creates the log group and stream, ignoring "already exists" so it
+// is safe to call after a ResourceNotFoundException.
+func (d *destination) create() {
+	cwlogs.CreateLogGroup(&cloudwatchlogs.CreateLogGroupInput{
+		LogGroupName: aws.String(d.group),
+	})
+	_, err := cwlogs.CreateLogStream(&cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String(d.group),
+		LogStreamName: aws.String(d.stream),
+	})
+	if err != nil {
+		log.Debugf("%s create stream: %v", d, err)
+	}
+}
+
+// setToken re-fetches the current sequence token after an
+// InvalidSequenceTokenException so the next upload can proceed.
+func (d *destination) setToken() {
+	out, err := cwlogs.DescribeLogStreams(&cloudwatchlogs.DescribeLogStreamsInput{
+		LogGroupName:        aws.String(d.group),
+		LogStreamNamePrefix: aws.String(d.stream),
+	})
+	if err != nil {
+		log.Debugf("%s describe streams: %v", d, err)
+		return
+	}
+	for _, s := range out.LogStreams {
+		if s.LogStreamName != nil && *s.LogStreamName == d.stream {
+			d.token = s.UploadSequenceToken
+			return
+		}
+	}
+}
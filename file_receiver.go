@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// pollInterval is how often the file receiver re-globs for new/rotated
+// files and persists offsets.
+const pollInterval = time.Second
+
+// fileReceiver tails every file matching a glob pattern, tracking each by
+// inode so rotation (new file created, old one renamed away) is detected
+// rather than producing duplicate or skipped lines.
+type fileReceiver struct {
+	pattern    string
+	offsetPath string
+
+	out  chan string
+	stop chan struct{}
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	offsets map[string]fileOffset // path -> last read position, persisted
+	tailing map[string]bool       // path -> a tailer goroutine already owns it
+}
+
+// fileOffset identifies a tailed file by inode (so a path reused after
+// rotation isn't mistaken for the same file) and the byte offset read so far.
+type fileOffset struct {
+	Inode  uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+}
+
+func newFileReceiver(pattern, offsetPath string) *fileReceiver {
+	return &fileReceiver{pattern: pattern, offsetPath: offsetPath}
+}
+
+func (r *fileReceiver) Listen() error {
+	r.out = make(chan string)
+	r.stop = make(chan struct{})
+	r.tailing = make(map[string]bool)
+	r.offsets = loadFileOffsets(r.offsetPath)
+	r.wg.Add(1)
+	go r.watch()
+	return nil
+}
+
+func (r *fileReceiver) Receive() <-chan string { return r.out }
+
+func (r *fileReceiver) Close() error {
+	close(r.stop)
+	r.wg.Wait()
+	close(r.out)
+	return nil
+}
+
+func (r *fileReceiver) watch() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		matches, err := filepath.Glob(r.pattern)
+		if err != nil {
+			log.Errorf("file receiver %s: %v", r.pattern, err)
+		}
+		for _, path := range matches {
+			r.mu.Lock()
+			already := r.tailing[path]
+			if !already {
+				r.tailing[path] = true
+			}
+			r.mu.Unlock()
+			if !already {
+				r.wg.Add(1)
+				go r.tail(path)
+			}
+		}
+		select {
+		case <-r.stop:
+			r.persistOffsets()
+			return
+		case <-ticker.C:
+			r.persistOffsets()
+		}
+	}
+}
+
+func (r *fileReceiver) tail(path string) {
+	defer r.wg.Done()
+	defer func() {
+		r.mu.Lock()
+		delete(r.tailing, path)
+		r.mu.Unlock()
+	}()
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Errorf("file receiver: open %s: %v", path, err)
+		return
+	}
+	defer f.Close()
+
+	inode := inodeOf(f)
+	r.mu.Lock()
+	prev, seen := r.offsets[path]
+	r.mu.Unlock()
+	whence, offset := seekFor(seen, prev, inode)
+	pos, _ := f.Seek(offset, whence)
+
+	// Track the logical read position ourselves: bufio.Reader prefetches
+	// past what ReadString has actually returned, so f.Seek(CUR) after the
+	// fact would overstate how much we've processed.
+	// A line read without its newline is still being written: hold it in
+	// partial until the rest arrives instead of dropping what was read.
+	reader := bufio.NewReader(f)
+	var partial string
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			partial += line
+		}
+		if len(line) > 0 && err == nil {
+			line, partial = partial+line, ""
+			r.out <- strings.TrimRight(line, "\r\n")
+			pos += int64(len(line))
+			r.mu.Lock()
+			r.offsets[path] = fileOffset{Inode: inode, Offset: pos}
+			r.mu.Unlock()
+			continue
+		}
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			if rotated(path, inode) {
+				return
+			}
+		}
+	}
+}
+
+// seekFor decides where a just-opened tail of path should start reading
+// from: resuming a previously seen file at its saved offset, starting a
+// rotated file (same path, new inode) at 0 since none of it has been read
+// yet, or starting a file new to this process at the end so it isn't
+// replayed from the beginning.
+func seekFor(seen bool, prev fileOffset, inode uint64) (whence int, offset int64) {
+	switch {
+	case seen && prev.Inode == inode:
+		return os.SEEK_SET, prev.Offset
+	case seen:
+		return os.SEEK_SET, 0
+	default:
+		return os.SEEK_END, 0
+	}
+}
+
+func rotated(path string, inode uint64) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	return inodeOfInfo(info) != inode
+}
+
+func loadFileOffsets(path string) map[string]fileOffset {
+	offsets := make(map[string]fileOffset)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return offsets
+	}
+	if err := json.Unmarshal(data, &offsets); err != nil {
+		log.Errorf("file receiver: corrupt offset file %s: %v", path, err)
+		return make(map[string]fileOffset)
+	}
+	return offsets
+}
+
+func (r *fileReceiver) persistOffsets() {
+	r.mu.Lock()
+	data, err := json.Marshal(r.offsets)
+	r.mu.Unlock()
+	if err != nil {
+		return
+	}
+	if err := ioutil.WriteFile(r.offsetPath, data, 0644); err != nil {
+		log.Errorf("file receiver: persisting offsets to %s: %v", r.offsetPath, err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSeekForNeverSeenStartsAtEnd(t *testing.T) {
+	whence, offset := seekFor(false, fileOffset{}, 42)
+	if whence != os.SEEK_END || offset != 0 {
+		t.Errorf("expected (SEEK_END, 0), got (%d, %d)", whence, offset)
+	}
+}
+
+func TestSeekForSameInodeResumesOffset(t *testing.T) {
+	whence, offset := seekFor(true, fileOffset{Inode: 7, Offset: 123}, 7)
+	if whence != os.SEEK_SET || offset != 123 {
+		t.Errorf("expected (SEEK_SET, 123), got (%d, %d)", whence, offset)
+	}
+}
+
+func TestSeekForRotatedInodeStartsAtZero(t *testing.T) {
+	// Same path as before, but the inode changed: rotation produced a file
+	// we haven't read any of, so it must not be treated like prev.Offset
+	// still applies, nor like a brand new path we should skip to the end of.
+	whence, offset := seekFor(true, fileOffset{Inode: 7, Offset: 123}, 8)
+	if whence != os.SEEK_SET || offset != 0 {
+		t.Errorf("expected (SEEK_SET, 0), got (%d, %d)", whence, offset)
+	}
+}
+
+func TestRotatedDetectsInodeChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filereceiver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	if err := ioutil.WriteFile(path, []byte("line 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inode := inodeOf(f)
+	f.Close()
+
+	if rotated(path, inode) {
+		t.Fatal("an untouched file should not look rotated")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("line 1 again\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !rotated(path, inode) {
+		t.Fatal("a recreated file should look rotated")
+	}
+}
+
+func TestRotatedMissingFile(t *testing.T) {
+	if !rotated(filepath.Join(os.TempDir(), "does-not-exist-go-forward-test"), 1) {
+		t.Fatal("a missing path should be treated as rotated away")
+	}
+}
+
+func TestFileOffsetsPersistRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filereceiver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	offsetPath := filepath.Join(dir, "receiver.offsets")
+	r := &fileReceiver{offsetPath: offsetPath, offsets: map[string]fileOffset{
+		"/var/log/app.log": {Inode: 99, Offset: 4096},
+	}}
+	r.persistOffsets()
+
+	loaded := loadFileOffsets(offsetPath)
+	if loaded["/var/log/app.log"] != (fileOffset{Inode: 99, Offset: 4096}) {
+		t.Errorf("expected offsets to round-trip, got %+v", loaded)
+	}
+}
+
+func TestLoadFileOffsetsMissingFile(t *testing.T) {
+	offsets := loadFileOffsets(filepath.Join(os.TempDir(), "does-not-exist-go-forward-offsets"))
+	if len(offsets) != 0 {
+		t.Errorf("expected an empty map for a missing offsets file, got %+v", offsets)
+	}
+}
@@ -0,0 +1,111 @@
+// +build linux,cgo
+
+package main
+
+import (
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+// journaldReceiver reads entries from the systemd journal via sd_journal,
+// resuming from a persisted cursor so a restart neither replays nor skips
+// entries.
+type journaldReceiver struct {
+	unit        string
+	priority    int
+	hasPriority bool
+	cursorPath  string
+
+	journal *sdjournal.Journal
+	out     chan string
+	stop    chan struct{}
+	wg      sync.WaitGroup // signals run() has returned and won't touch journal again
+}
+
+func newJournaldReceiver(u *url.URL, cursorPath string) *journaldReceiver {
+	q := u.Query()
+	r := &journaldReceiver{unit: q.Get("unit"), cursorPath: cursorPath}
+	if p := q.Get("priority"); p != "" {
+		if n, err := strconv.Atoi(p); err == nil {
+			r.priority, r.hasPriority = n, true
+		}
+	}
+	return r
+}
+
+func (r *journaldReceiver) Listen() error {
+	j, err := sdjournal.NewJournal()
+	if err != nil {
+		return err
+	}
+	if r.unit != "" {
+		if err := j.AddMatch(sdjournal.SD_JOURNAL_FIELD_SYSTEMD_UNIT + "=" + r.unit); err != nil {
+			return err
+		}
+	}
+	if r.hasPriority {
+		if err := j.AddMatch(sdjournal.SD_JOURNAL_FIELD_PRIORITY + "=" + strconv.Itoa(r.priority)); err != nil {
+			return err
+		}
+	}
+	if cursor, err := ioutil.ReadFile(r.cursorPath); err == nil {
+		if err := j.SeekCursor(strings.TrimSpace(string(cursor))); err == nil {
+			j.NextSkip(1) // the cursor points at the last entry we already emitted
+		}
+	} else {
+		j.SeekTail()
+	}
+
+	r.journal = j
+	r.out = make(chan string)
+	r.stop = make(chan struct{})
+	r.wg.Add(1)
+	go r.run()
+	return nil
+}
+
+func (r *journaldReceiver) run() {
+	defer r.wg.Done()
+	defer close(r.out)
+	for {
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+		n, err := r.journal.Next()
+		if err != nil {
+			log.Errorf("journald receiver: %v", err)
+			return
+		}
+		if n == 0 {
+			r.journal.Wait(time.Second)
+			continue
+		}
+		entry, err := r.journal.GetEntry()
+		if err != nil {
+			continue
+		}
+		r.out <- entry.Fields["MESSAGE"]
+		if cursor, err := r.journal.GetCursor(); err == nil {
+			ioutil.WriteFile(r.cursorPath, []byte(cursor), 0644)
+		}
+	}
+}
+
+func (r *journaldReceiver) Receive() <-chan string { return r.out }
+
+func (r *journaldReceiver) Close() error {
+	close(r.stop)
+	// run() may be blocked in journal.Next()/journal.Wait(); wait for it to
+	// observe stop and return before closing the handle out from under it.
+	r.wg.Wait()
+	return r.journal.Close()
+}
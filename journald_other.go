@@ -0,0 +1,25 @@
+// +build !linux !cgo
+
+package main
+
+import (
+	"errors"
+	"net/url"
+)
+
+// journaldReceiver is unavailable on this platform/build (sd_journal needs
+// linux + cgo); it fails Listen rather than silently dropping the flow's
+// events.
+type journaldReceiver struct{}
+
+func newJournaldReceiver(u *url.URL, cursorPath string) *journaldReceiver {
+	return &journaldReceiver{}
+}
+
+func (r *journaldReceiver) Listen() error {
+	return errors.New("journald receiver requires a linux build with cgo enabled")
+}
+
+func (r *journaldReceiver) Receive() <-chan string { return nil }
+
+func (r *journaldReceiver) Close() error { return nil }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/Sirupsen/logrus/hooks/syslog"
+)
+
+type outputKind int
+
+const (
+	outputStderr outputKind = iota
+	outputSyslog
+)
+
+var strToOutput = map[string]outputKind{
+	"stderr": outputStderr,
+	"syslog": outputSyslog,
+}
+
+var strToLevel = map[string]log.Level{
+	"debug":   log.DebugLevel,
+	"info":    log.InfoLevel,
+	"warning": log.WarnLevel,
+	"error":   log.ErrorLevel,
+}
+
+// programFormat keeps log lines short and greppable in the places this
+// agent is actually run from (syslog, journal, init scripts).
+type programFormat struct{}
+
+func (f *programFormat) Format(entry *log.Entry) ([]byte, error) {
+	msg := []byte(entry.Level.String() + ": " + entry.Message + "\n")
+	return msg, nil
+}
+
+// pickHook returns the logrus hook matching the configured [main] log_output,
+// falling back to stderr-only logging (handled by the default output) when
+// no hook is needed.
+func pickHook(kind outputKind) log.Hook {
+	switch kind {
+	case outputSyslog:
+		hook, err := logrus_syslog.NewSyslogHook("", "", 0, "logs_agent")
+		if err != nil {
+			log.Errorf("unable to connect to syslog: %v", err)
+			return nil
+		}
+		return hook
+	default:
+		return nil
+	}
+}
+
+// debug sets the log level to debug when LOGS_AGENT_DEBUG is set. It runs
+// from init, so it only affects logging until main first sets the level,
+// which happens right after the flags are parsed and before the config file
+// is read.
+func debug() {
+	if os.Getenv("LOGS_AGENT_DEBUG") != "" {
+		log.SetLevel(log.DebugLevel)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sync"
 	"syscall"
 	"text/template"
@@ -48,10 +49,12 @@ func main() {
 	}
 	settings := config.GetMain()
 	flows := config.GetFlows()
+	startMetrics(config.GetMetrics())
 	setServices()
 	log.SetOutput(ioutil.Discard)
-	hook := pickHook(strToOutput[settings.LogOutput])
-	log.AddHook(hook)
+	if hook := pickHook(strToOutput[settings.LogOutput]); hook != nil {
+		log.AddHook(hook)
+	}
 	log.SetLevel(strToLevel[settings.LogLevel])
 	receivers := setupFlows(flows)
 	signals := make(chan os.Signal, 1)
@@ -87,7 +90,7 @@ func closeAll(receivers []receiver) {
 func setupFlows(flows []*FlowCfg) (receivers []receiver) {
 	log.Debug("seting flow")
 	for _, flow := range flows {
-		receiver := newReceiver(flow.Source)
+		receiver := newReceiver(flow)
 		receivers = append(receivers, receiver)
 		if err := receiver.Listen(); err != nil {
 			closeAll(receivers)
@@ -96,50 +99,113 @@ func setupFlows(flows []*FlowCfg) (receivers []receiver) {
 		in := receiver.Receive()
 		out := make(chan logEvent)
 		format, _ := template.New("").Parse(flow.CloudwatchFormat)
-		go convertEvents(in, out, parserFunctions[flow.SyslogFormat], format)
+		streamTpl, err := template.New("").Parse(flow.Stream)
+		if err != nil {
+			closeAll(receivers)
+			log.Fatalf("%s: invalid stream template: %v", flow.Name, err)
+		}
+		vars := getStreamVars()
+		mline, err := newMultilineConfig(flow)
+		if err != nil {
+			log.Errorf("%s: invalid multiline_pattern, disabling multiline: %v", flow.Name, err)
+		}
+		go convertEvents(flow.Name, in, out, parserFunctions[flow.SyslogFormat], format, mline, streamTpl, vars)
 		wg.Add(1)
 		go recToDst(out, flow)
 	}
 	return
 }
 
-// Parse, filter incoming messages and send them to destination.
-func convertEvents(in <-chan string, out chan<- logEvent, parsefn syslogParser, tpl *template.Template) {
+// Parse, filter incoming messages and send them to destination. When mline
+// is set, parsed records are coalesced into multi-line events before being
+// rendered; otherwise each parsed record becomes its own logEvent. streamTpl
+// is evaluated per record (not just once per flow) so cfg.Stream can mix
+// host-level vars with fields off the parsed record, e.g. "{{.App}}/{{.Host}}".
+func convertEvents(flowName string, in <-chan string, out chan<- logEvent, parsefn syslogParser, tpl *template.Template, mline *multilineConfig, streamTpl *template.Template, vars streamVars) {
 	defer close(out)
 	buf := bytes.NewBuffer([]byte{})
-	for msg := range in {
-		parsed, err := parsefn(msg)
-		if err != nil {
-			continue
-		}
-		err = parsed.render(tpl, buf)
-		if err != nil {
-			continue
-		}
-		// Timestamp must be in milliseconds
-		event := logEvent{
-			msg:       buf.String(),
-			timestamp: parsed.timestamp.Unix() * 1000,
+
+	if mline == nil {
+		for msg := range in {
+			parsed, err := parsefn(msg)
+			if err != nil {
+				eventsDropped.WithLabelValues(flowName, "parse").Inc()
+				continue
+			}
+			emitRecord(flowName, parsed, tpl, streamTpl, vars, buf, out)
 		}
-		err = event.validate()
-		if err != nil {
-			continue
+		return
+	}
+
+	coalescer := newMultilineCoalescer(mline)
+	ticker := time.NewTicker(mline.timeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg, opened := <-in:
+			if !opened {
+				for _, rec := range coalescer.drain() {
+					emitRecord(flowName, rec, tpl, streamTpl, vars, buf, out)
+				}
+				return
+			}
+			parsed, err := parsefn(msg)
+			if err != nil {
+				eventsDropped.WithLabelValues(flowName, "parse").Inc()
+				continue
+			}
+			for _, rec := range coalescer.add(parsed) {
+				emitRecord(flowName, rec, tpl, streamTpl, vars, buf, out)
+			}
+		case <-ticker.C:
+			for _, rec := range coalescer.expireStale() {
+				emitRecord(flowName, rec, tpl, streamTpl, vars, buf, out)
+			}
 		}
-		out <- event
 	}
 }
 
-// Buffer received events and send them to cloudwatch.
+// emitRecord renders a parsed record and its stream name, then pushes the
+// result onto out, dropping it silently on render or validation failure
+// (oversized/invalid messages).
+func emitRecord(flowName string, parsed *parsedRecord, tpl, streamTpl *template.Template, vars streamVars, buf *bytes.Buffer, out chan<- logEvent) {
+	if err := parsed.render(tpl, buf); err != nil {
+		eventsDropped.WithLabelValues(flowName, "validate").Inc()
+		return
+	}
+	msg := buf.String()
+
+	buf.Reset()
+	if err := streamTpl.Execute(buf, newStreamTemplateData(vars, parsed)); err != nil {
+		eventsDropped.WithLabelValues(flowName, "validate").Inc()
+		return
+	}
+
+	// Timestamp must be in milliseconds
+	event := logEvent{
+		msg:       msg,
+		timestamp: parsed.timestamp.Unix() * 1000,
+		stream:    buf.String(),
+	}
+	if err := event.validate(); err != nil {
+		eventsDropped.WithLabelValues(flowName, "validate").Inc()
+		return
+	}
+	eventsReceived.WithLabelValues(flowName).Inc()
+	out <- event
+}
+
+// Buffer received events and send them to cloudwatch. A flow can fan out to
+// many streams when cfg.Stream references per-record fields, so recToDst
+// keeps one destination/queue/ticker per distinct rendered stream name
+// rather than a single one resolved up front.
 func recToDst(in <-chan logEvent, cfg *FlowCfg) {
 	defer wg.Done()
-	stream_vars := getStreamVars()
-	stream_name := stream_vars.render(cfg.Stream)
-	dst := newDestination(stream_name, cfg.Group)
-	ticker := newDelayTicker(cfg.UploadDelay, dst)
-	defer ticker.Stop()
-	queue := &eventQueue{max_size: cfg.QueueSize}
-	var uploadDone chan batchFunc
-	var batch eventsList
+	streams := make(map[string]*streamState)
+	spoolNames := make(map[string]string) // claimSpoolName's collision guard, shared across this flow's streams
+	tickCh := make(chan string)
+	doneCh := make(chan streamResult)
+
 	for {
 		select {
 		case event, opened := <-in:
@@ -147,20 +213,86 @@ func recToDst(in <-chan logEvent, cfg *FlowCfg) {
 				in = nil
 				break
 			}
-			queue.add(event)
-		case fn := <-uploadDone:
-			fn(batch, queue)
-			uploadDone = nil
-		case <-ticker.C:
-			log.Debugf("%s tick", dst)
-			if !queue.empty() && uploadDone == nil {
-				uploadDone, batch = upload(dst, queue)
+			state, ok := streams[event.stream]
+			if !ok {
+				state = newStreamState(event.stream, cfg, tickCh, spoolNames)
+				streams[event.stream] = state
+			}
+			state.queue.add(event)
+		case name := <-tickCh:
+			state, ok := streams[name]
+			if !ok || state.uploading || state.queue.empty() {
+				break
+			}
+			log.Debugf("%s tick", state.dst)
+			state.uploading = true
+			uploadDone, batch := upload(state.dst, state.queue)
+			state.batch = batch
+			go func(name string, uploadDone chan batchFunc) {
+				doneCh <- streamResult{stream: name, fn: <-uploadDone}
+			}(name, uploadDone)
+		case result := <-doneCh:
+			state, ok := streams[result.stream]
+			if !ok {
+				break
 			}
+			result.fn(state.batch, state.queue)
+			state.uploading = false
 		}
-		if in == nil && queue.empty() {
+		if in == nil && allStreamsEmpty(streams) {
 			break
 		}
 	}
+	for _, state := range streams {
+		state.ticker.Stop()
+	}
+}
+
+// streamState is the per-destination pipeline state recToDst fans events
+// out to: its own destination (sequence token included), its own spooled
+// queue, and its own upload ticker.
+type streamState struct {
+	dst       *destination
+	queue     *eventQueue
+	ticker    *time.Ticker
+	uploading bool
+	batch     eventsList
+}
+
+// streamResult carries an upload outcome back to recToDst's single select
+// loop, tagged with which stream it belongs to.
+type streamResult struct {
+	stream string
+	fn     batchFunc
+}
+
+func newStreamState(name string, cfg *FlowCfg, tickCh chan<- string, spoolNames map[string]string) *streamState {
+	dst := newDestination(name, cfg.Group)
+	// name is the rendered stream template and may contain "/" or ".." from
+	// attacker-controlled syslog fields; sanitize it (and disambiguate it
+	// against every other stream this flow has already claimed) before it
+	// becomes a spool directory component. The unsanitized name is still
+	// used for the actual CloudWatch stream above.
+	queue, err := newEventQueue(filepath.Join(cfg.SpoolDir, claimSpoolName(name, spoolNames)), cfg.QueueSize, cfg.Name, name)
+	if err != nil {
+		log.Fatalf("%s: spool: %v", dst, err)
+	}
+	ticker := newDelayTicker(cfg.UploadDelay, dst)
+	go func() {
+		for range ticker.C {
+			tickCh <- name
+		}
+	}()
+	return &streamState{dst: dst, queue: queue, ticker: ticker}
+}
+
+func allStreamsEmpty(streams map[string]*streamState) bool {
+	for _, state := range streams {
+		if state.uploading || !state.queue.empty() {
+			return false
+		}
+	}
+	return true
 }
 
 func newDelayTicker(delay upload_delay, dst *destination) *time.Ticker {
@@ -176,10 +308,14 @@ func newDelayTicker(delay upload_delay, dst *destination) *time.Ticker {
 */
 func upload(dst *destination, queue *eventQueue) (out chan batchFunc, batch eventsList) {
 	batch = queue.getBatch()
+	batchBytes.Observe(float64(batch.size()))
 	out = make(chan batchFunc)
 	log.Debugf("%s sending %d messages", dst, len(batch))
 	go func() {
+		dst.limiter.Wait()
+		start := time.Now()
 		result := dst.upload(batch)
+		putLogEventsLatency.Observe(time.Since(start).Seconds())
 		out <- handleResult(dst, result)
 	}()
 	return out, batch
@@ -191,44 +327,79 @@ func handleResult(dst *destination, result error) batchFunc {
 		switch err.Code() {
 		case "InvalidSequenceTokenException":
 			log.Debugf("%s invalid sequence token", dst)
+			putLogEvents.WithLabelValues("invalid_token").Inc()
+			tokenRefreshes.Inc()
 			dst.setToken()
 			return addBack
 		case "ResourceNotFoundException":
 			log.Debugf("%s missing group/stream", dst)
+			putLogEvents.WithLabelValues("not_found").Inc()
 			dst.create()
 			dst.token = nil
 			return addBack
+		case "ThrottlingException":
+			log.Debugf("%s throttled", dst)
+			putLogEvents.WithLabelValues("throttle").Inc()
+			return addBack
 		default:
 			log.Errorf("upload to %s failed %s %s", dst, err.Code(), err.Message())
+			putLogEvents.WithLabelValues("error").Inc()
 		}
 	case nil:
+		putLogEvents.WithLabelValues("ok").Inc()
+		return commit
 	default:
 		log.Errorf("upload to %s failed %s ", dst, result)
+		putLogEvents.WithLabelValues("error").Inc()
 	}
 	return discard
 }
 
 type batchFunc func(batch eventsList, queue *eventQueue)
 
-func addBack(batch eventsList, queue *eventQueue) {
-	queue.add(batch...)
+// commit advances the spool past the uploaded batch, removing its segment
+// once every event in it has been committed.
+func commit(batch eventsList, queue *eventQueue) {
+	queue.commit()
 }
 
+// addBack and discard are no-ops: the batch's segment is still sitting on
+// disk (getBatch never deletes it), so leaving it there is what retries it
+// on the next tick. Only commit, on a successful upload, removes it.
+func addBack(batch eventsList, queue *eventQueue) {}
+
 func discard(batch eventsList, queue *eventQueue) {}
 
+// streamVars is the host-level identity available to every stream template,
+// resolved once per flow at startup.
 type streamVars struct {
 	InstanceID string
 	Hostname   string
 }
 
-func (v streamVars) render(format string) string {
-	buf := bytes.NewBuffer([]byte{})
-	tpl, err := template.New("").Parse(format)
-	if err != nil {
-		log.Fatalf("failed to render stream name: %v", err)
+// streamTemplateData is what cfg.Stream templates render against: host-level
+// identity plus the fields of the record that is about to be emitted, so a
+// stream name can mix both, e.g. "{{.App}}/{{.Hostname}}".
+type streamTemplateData struct {
+	InstanceID string
+	Hostname   string
+	App        string
+	Procid     string
+	Severity   string
+	Facility   string
+	Host       string
+}
+
+func newStreamTemplateData(vars streamVars, p *parsedRecord) streamTemplateData {
+	return streamTemplateData{
+		InstanceID: vars.InstanceID,
+		Hostname:   vars.Hostname,
+		App:        p.App,
+		Procid:     p.Procid,
+		Severity:   p.Severity,
+		Facility:   p.Facility,
+		Host:       p.Host,
 	}
-	tpl.Execute(buf, v)
-	return buf.String()
 }
 
 func getStreamVars() (variables streamVars) {
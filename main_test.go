@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestNewStreamTemplateDataMapsFields(t *testing.T) {
+	vars := streamVars{InstanceID: "i-123", Hostname: "host-a"}
+	parsed := &parsedRecord{
+		Host:     "rhost",
+		App:      "app",
+		Procid:   "42",
+		Severity: "info",
+		Facility: "local0",
+	}
+	data := newStreamTemplateData(vars, parsed)
+	want := streamTemplateData{
+		InstanceID: "i-123",
+		Hostname:   "host-a",
+		App:        "app",
+		Procid:     "42",
+		Severity:   "info",
+		Facility:   "local0",
+		Host:       "rhost",
+	}
+	if data != want {
+		t.Errorf("got %+v, want %+v", data, want)
+	}
+}
+
+func TestEmitRecordRendersMessageAndStream(t *testing.T) {
+	tpl, err := template.New("").Parse("{{.App}}: {{.Message}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamTpl, err := template.New("").Parse("{{.Hostname}}/{{.App}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := &parsedRecord{
+		timestamp: time.Unix(1700000000, 0),
+		App:       "myapp",
+		Message:   "hello",
+	}
+	vars := streamVars{Hostname: "host-a"}
+	out := make(chan logEvent, 1)
+	buf := bytes.NewBuffer(nil)
+
+	emitRecord("flow", parsed, tpl, streamTpl, vars, buf, out)
+
+	select {
+	case event := <-out:
+		if event.msg != "myapp: hello" {
+			t.Errorf("expected rendered msg %q, got %q", "myapp: hello", event.msg)
+		}
+		if event.stream != "host-a/myapp" {
+			t.Errorf("expected rendered stream %q, got %q", "host-a/myapp", event.stream)
+		}
+		if event.timestamp != 1700000000*1000 {
+			t.Errorf("expected timestamp in ms, got %d", event.timestamp)
+		}
+	default:
+		t.Fatal("expected emitRecord to send an event")
+	}
+}
+
+func TestEmitRecordDropsOnStreamTemplateError(t *testing.T) {
+	tpl, err := template.New("").Parse("{{.Message}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// References a field streamTemplateData doesn't have, so Execute fails.
+	streamTpl, err := template.New("").Parse("{{.NoSuchField}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := &parsedRecord{timestamp: time.Unix(0, 0), Message: "hi"}
+	out := make(chan logEvent, 1)
+	buf := bytes.NewBuffer(nil)
+
+	emitRecord("flow", parsed, tpl, streamTpl, streamVars{}, buf, out)
+
+	select {
+	case event := <-out:
+		t.Fatalf("expected no event to be emitted, got %+v", event)
+	default:
+	}
+}
+
+func TestClaimSpoolNameDisambiguatesCollisions(t *testing.T) {
+	claimed := make(map[string]string)
+
+	first := claimSpoolName("host/app", claimed)
+	second := claimSpoolName("host_app", claimed)
+
+	if first != "host_app" {
+		t.Errorf("expected the first claimant to get the plain sanitized name, got %q", first)
+	}
+	if second == first {
+		t.Fatal("expected the colliding second claimant to get a different name")
+	}
+}
+
+func TestClaimSpoolNameIsIdempotentForTheSameName(t *testing.T) {
+	claimed := make(map[string]string)
+
+	first := claimSpoolName("host/app", claimed)
+	again := claimSpoolName("host/app", claimed)
+
+	if first != again {
+		t.Errorf("expected re-claiming the same name to return the same result, got %q and %q", first, again)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics give operators the queue depth, batch, retry and drop visibility
+// that the log.Debugf-only pipeline doesn't: eventsReceived/eventsDropped
+// cover convertEvents and eventQueue.add, queueDepth tracks the spool,
+// batchBytes/putLogEvents/putLogEventsLatency/tokenRefreshes cover upload
+// and handleResult.
+var (
+	eventsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "goforward_events_received_total",
+		Help: "Events successfully parsed, rendered and queued for upload.",
+	}, []string{"flow"})
+
+	eventsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "goforward_events_dropped_total",
+		Help: "Events dropped before a successful upload, by reason.",
+	}, []string{"flow", "reason"})
+
+	queueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "goforward_queue_depth",
+		Help: "Events currently spooled on disk awaiting upload.",
+	}, []string{"flow", "stream"})
+
+	batchBytes = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "goforward_batch_bytes",
+		Help:    "Size in bytes of PutLogEvents batches, including per-event overhead.",
+		Buckets: prometheus.ExponentialBuckets(1024, 2, 12),
+	})
+
+	putLogEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "goforward_putlogevents_total",
+		Help: "PutLogEvents calls by result.",
+	}, []string{"result"})
+
+	putLogEventsLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "goforward_putlogevents_latency_seconds",
+		Help:    "PutLogEvents call latency.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	tokenRefreshes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "goforward_sequence_token_refresh_total",
+		Help: "Sequence token re-fetches after an InvalidSequenceTokenException.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		eventsReceived,
+		eventsDropped,
+		queueDepth,
+		batchBytes,
+		putLogEvents,
+		putLogEventsLatency,
+		tokenRefreshes,
+	)
+}
+
+// startMetrics serves the Prometheus scrape endpoint in the background if
+// cfg declares a listen address; otherwise it does nothing.
+func startMetrics(cfg MetricsCfg) {
+	if !cfg.Enabled {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Path, promhttp.Handler())
+	go func() {
+		if err := http.ListenAndServe(cfg.Listen, mux); err != nil {
+			log.Errorf("metrics server on %s: %v", cfg.Listen, err)
+		}
+	}()
+	log.Infof("serving metrics on %s%s", cfg.Listen, cfg.Path)
+}
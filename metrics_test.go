@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestEventsReceivedIncrements(t *testing.T) {
+	eventsReceived.Reset()
+	eventsReceived.WithLabelValues("flow-a").Inc()
+	eventsReceived.WithLabelValues("flow-a").Inc()
+	if got := testutil.ToFloat64(eventsReceived.WithLabelValues("flow-a")); got != 2 {
+		t.Errorf("expected eventsReceived{flow-a}=2, got %v", got)
+	}
+}
+
+func TestEventsDroppedLabelsByReason(t *testing.T) {
+	eventsDropped.Reset()
+	eventsDropped.WithLabelValues("flow-a", "parse").Inc()
+	eventsDropped.WithLabelValues("flow-a", "validate").Inc()
+	eventsDropped.WithLabelValues("flow-a", "validate").Inc()
+	if got := testutil.ToFloat64(eventsDropped.WithLabelValues("flow-a", "parse")); got != 1 {
+		t.Errorf("expected eventsDropped{flow-a,parse}=1, got %v", got)
+	}
+	if got := testutil.ToFloat64(eventsDropped.WithLabelValues("flow-a", "validate")); got != 2 {
+		t.Errorf("expected eventsDropped{flow-a,validate}=2, got %v", got)
+	}
+}
+
+func TestQueueDepthGaugeTracksAddAndSub(t *testing.T) {
+	queueDepth.Reset()
+	queueDepth.WithLabelValues("flow-a", "stream-a").Inc()
+	queueDepth.WithLabelValues("flow-a", "stream-a").Inc()
+	queueDepth.WithLabelValues("flow-a", "stream-a").Sub(1)
+	if got := testutil.ToFloat64(queueDepth.WithLabelValues("flow-a", "stream-a")); got != 1 {
+		t.Errorf("expected queueDepth{flow-a,stream-a}=1, got %v", got)
+	}
+}
+
+func TestStartMetricsDisabledIsNoOp(t *testing.T) {
+	// Enabled defaults to false; with no Listen address set either, the only
+	// way this could misbehave is by trying to bind one anyway.
+	startMetrics(MetricsCfg{})
+}
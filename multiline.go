@@ -0,0 +1,142 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// multilineConfig is the compiled form of a flow's Multiline* ini settings.
+// A nil *multilineConfig means the flow emits one logEvent per parsed line,
+// as before.
+type multilineConfig struct {
+	startPattern *regexp.Regexp
+	timeout      time.Duration
+	maxLines     int
+}
+
+func newMultilineConfig(flow *FlowCfg) (*multilineConfig, error) {
+	if flow.MultilinePattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(flow.MultilinePattern)
+	if err != nil {
+		return nil, err
+	}
+	timeout := flow.MultilineTimeout
+	if timeout <= 0 {
+		timeout = 500 * time.Millisecond
+	}
+	maxLines := flow.MultilineMaxLines
+	if maxLines <= 0 {
+		maxLines = 500
+	}
+	return &multilineConfig{startPattern: re, timeout: timeout, maxLines: maxLines}, nil
+}
+
+// multilineKey groups records coming from the same logical source so a
+// stack trace on one (host, app, procid) never gets interleaved with
+// another's.
+type multilineKey struct {
+	host, app, procid string
+}
+
+func keyFor(p *parsedRecord) multilineKey {
+	return multilineKey{host: p.Host, app: p.App, procid: p.Procid}
+}
+
+// multilineEntry is the in-progress buffer for one key: the header record
+// (whose timestamp and fields the flushed event inherits) plus every line
+// seen since, including the header's own message.
+type multilineEntry struct {
+	header   parsedRecord
+	lines    []string
+	lastSeen time.Time
+}
+
+const truncatedMarker = "\n...[truncated, maximum event size exceeded]"
+
+func (e *multilineEntry) flush() *parsedRecord {
+	rec := e.header
+	rec.Message = strings.Join(e.lines, "\n")
+	if len(rec.Message)+eventSizeOverhead+len(truncatedMarker) > maxEventSize {
+		limit := maxEventSize - eventSizeOverhead - len(truncatedMarker)
+		if limit < 0 {
+			limit = 0
+		}
+		rec.Message = rec.Message[:limit] + truncatedMarker
+	}
+	return &rec
+}
+
+func (e *multilineEntry) overflowing(maxLines int) bool {
+	if len(e.lines) >= maxLines {
+		return true
+	}
+	size := 0
+	for _, l := range e.lines {
+		size += len(l) + 1
+	}
+	return size+eventSizeOverhead > maxEventSize
+}
+
+// multilineCoalescer buffers parsed records per (host, app, procid) and
+// flushes them as a single merged record, either when a new entry's message
+// matches the start-of-entry pattern, when the buffer goes stale, or when it
+// grows past MultilineMaxLines/maxEventSize.
+type multilineCoalescer struct {
+	cfg     *multilineConfig
+	buffers map[multilineKey]*multilineEntry
+}
+
+func newMultilineCoalescer(cfg *multilineConfig) *multilineCoalescer {
+	return &multilineCoalescer{cfg: cfg, buffers: make(map[multilineKey]*multilineEntry)}
+}
+
+// add appends p to its buffer and returns any records that need to be
+// flushed as a result: the previous buffer if p starts a new logical entry,
+// and/or the buffer itself if it just overflowed.
+func (c *multilineCoalescer) add(p *parsedRecord) (flushed []*parsedRecord) {
+	key := keyFor(p)
+	entry, buffered := c.buffers[key]
+
+	if buffered && c.cfg.startPattern.MatchString(p.Message) {
+		flushed = append(flushed, entry.flush())
+		delete(c.buffers, key)
+		entry, buffered = nil, false
+	}
+	if !buffered {
+		entry = &multilineEntry{header: *p}
+		c.buffers[key] = entry
+	}
+	entry.lines = append(entry.lines, p.Message)
+	entry.lastSeen = time.Now()
+
+	if entry.overflowing(c.cfg.maxLines) {
+		flushed = append(flushed, entry.flush())
+		delete(c.buffers, key)
+	}
+	return
+}
+
+// expireStale flushes every buffer that has seen no activity for the
+// configured timeout.
+func (c *multilineCoalescer) expireStale() (flushed []*parsedRecord) {
+	cutoff := time.Now().Add(-c.cfg.timeout)
+	for key, entry := range c.buffers {
+		if entry.lastSeen.Before(cutoff) {
+			flushed = append(flushed, entry.flush())
+			delete(c.buffers, key)
+		}
+	}
+	return
+}
+
+// drain flushes every remaining buffer; used on shutdown.
+func (c *multilineCoalescer) drain() (flushed []*parsedRecord) {
+	for key, entry := range c.buffers {
+		flushed = append(flushed, entry.flush())
+		delete(c.buffers, key)
+	}
+	return
+}
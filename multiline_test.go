@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewMultilineConfigDisabledWithoutPattern(t *testing.T) {
+	cfg, err := newMultilineConfig(&FlowCfg{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg != nil {
+		t.Fatal("expected a nil config when MultilinePattern is empty")
+	}
+}
+
+func TestNewMultilineConfigAppliesDefaults(t *testing.T) {
+	cfg, err := newMultilineConfig(&FlowCfg{MultilinePattern: `^\d{4}-`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.timeout != 500*time.Millisecond {
+		t.Errorf("expected default timeout 500ms, got %v", cfg.timeout)
+	}
+	if cfg.maxLines != 500 {
+		t.Errorf("expected default maxLines 500, got %d", cfg.maxLines)
+	}
+}
+
+func TestNewMultilineConfigInvalidPattern(t *testing.T) {
+	if _, err := newMultilineConfig(&FlowCfg{MultilinePattern: `(`}); err == nil {
+		t.Fatal("expected an error for an invalid regexp")
+	}
+}
+
+func TestMultilineCoalescerMergesContinuationLines(t *testing.T) {
+	cfg, err := newMultilineConfig(&FlowCfg{MultilinePattern: `^\d{4}-`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newMultilineCoalescer(cfg)
+
+	if flushed := c.add(&parsedRecord{Host: "h", App: "a", Message: "2024-01-01 started"}); flushed != nil {
+		t.Fatalf("starting the first entry should not flush anything, got %+v", flushed)
+	}
+	if flushed := c.add(&parsedRecord{Host: "h", App: "a", Message: "  at foo.go:1"}); flushed != nil {
+		t.Fatalf("a continuation line should not flush, got %+v", flushed)
+	}
+
+	flushed := c.add(&parsedRecord{Host: "h", App: "a", Message: "2024-01-01 next"})
+	if len(flushed) != 1 {
+		t.Fatalf("expected the previous entry to flush when a new one starts, got %d", len(flushed))
+	}
+	want := "2024-01-01 started\n  at foo.go:1"
+	if flushed[0].Message != want {
+		t.Errorf("expected merged message %q, got %q", want, flushed[0].Message)
+	}
+}
+
+func TestMultilineCoalescerKeepsDistinctKeysSeparate(t *testing.T) {
+	cfg, err := newMultilineConfig(&FlowCfg{MultilinePattern: `^START`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newMultilineCoalescer(cfg)
+
+	c.add(&parsedRecord{Host: "h", App: "a", Message: "START a"})
+	c.add(&parsedRecord{Host: "h", App: "b", Message: "START b"})
+	c.add(&parsedRecord{Host: "h", App: "a", Message: "continues a"})
+
+	flushed := c.drain()
+	if len(flushed) != 2 {
+		t.Fatalf("expected one buffer per (host, app, procid) key, got %d", len(flushed))
+	}
+}
+
+func TestMultilineCoalescerOverflowFlushesImmediately(t *testing.T) {
+	cfg, err := newMultilineConfig(&FlowCfg{MultilinePattern: `^START`, MultilineMaxLines: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newMultilineCoalescer(cfg)
+
+	c.add(&parsedRecord{Host: "h", App: "a", Message: "START"})
+	flushed := c.add(&parsedRecord{Host: "h", App: "a", Message: "line 2"})
+	if len(flushed) != 1 {
+		t.Fatalf("expected the buffer to flush once it hit maxLines, got %d", len(flushed))
+	}
+	if len(c.buffers) != 0 {
+		t.Fatal("the overflowed buffer should have been removed")
+	}
+}
+
+func TestMultilineCoalescerExpireStale(t *testing.T) {
+	cfg, err := newMultilineConfig(&FlowCfg{MultilinePattern: `^START`, MultilineTimeout: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newMultilineCoalescer(cfg)
+	c.add(&parsedRecord{Host: "h", App: "a", Message: "START"})
+
+	time.Sleep(5 * time.Millisecond)
+	flushed := c.expireStale()
+	if len(flushed) != 1 {
+		t.Fatalf("expected the stale buffer to flush, got %d", len(flushed))
+	}
+	if len(c.buffers) != 0 {
+		t.Fatal("expireStale should remove what it flushes")
+	}
+}
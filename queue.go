@@ -0,0 +1,51 @@
+package main
+
+import "errors"
+
+// eventSizeOverhead is the per-event byte overhead PutLogEvents charges
+// against the 1MB batch limit, on top of the UTF-8 message bytes.
+const eventSizeOverhead = 26
+
+// maxEventSize is the maximum size, in bytes including eventSizeOverhead,
+// of a single PutLogEvents message.
+const maxEventSize = 256 * 1024
+
+var errMessageTooBig = errors.New("event exceeds maximum message size")
+
+type logEvent struct {
+	msg       string
+	timestamp int64
+	stream    string // rendered destination stream name; set by emitRecord
+}
+
+func (e logEvent) size() int {
+	return len(e.msg) + eventSizeOverhead
+}
+
+func (e logEvent) validate() error {
+	if e.size() > maxEventSize {
+		return errMessageTooBig
+	}
+	return nil
+}
+
+// messageBatch is a batch of events ordered for PutLogEvents, which requires
+// them sorted ascending by timestamp.
+type messageBatch []logEvent
+
+func (b messageBatch) Len() int      { return len(b) }
+func (b messageBatch) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b messageBatch) Less(i, j int) bool {
+	return b[i].timestamp < b[j].timestamp
+}
+
+func (b messageBatch) size() (total int) {
+	for _, e := range b {
+		total += e.size()
+	}
+	return
+}
+
+// eventsList is the batch type recToDst/upload move around; it is a
+// messageBatch so it sorts and sizes the same way.
+type eventsList = messageBatch
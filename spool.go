@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// spoolNameReplacer collapses path separators out of a rendered stream name
+// so it can only ever land as a single, flat component under a flow's
+// SpoolDir. Stream names come from cfg.Stream templates, which can mix in
+// unauthenticated syslog fields (e.g. "{{.App}}/{{.Host}}"), so "/" and "\"
+// must not be allowed through to filepath.Join.
+var spoolNameReplacer = strings.NewReplacer("/", "_", "\\", "_")
+
+// sanitizeSpoolName turns a rendered stream name into a safe spool directory
+// component. Besides stripping path separators, it rejects "." and ".." —
+// which contain no separator but still resolve to "this/parent directory"
+// when passed to filepath.Join — so a crafted stream name can't escape
+// SpoolDir via path traversal.
+func sanitizeSpoolName(name string) string {
+	name = spoolNameReplacer.Replace(name)
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+// claimSpoolName sanitizes name and registers the result in claimed, which
+// the caller keeps per flow across every rendered stream name it has seen.
+// Two different rendered names can sanitize to the same string (e.g.
+// "host/app" and "host_app" both become "host_app"); since each rendered
+// name gets its own eventQueue, an undetected collision would let two
+// queues write into the same directory and corrupt each other's segments.
+// When that happens, the second claimant is given a name-derived suffix
+// instead, and the collision is logged.
+func claimSpoolName(name string, claimed map[string]string) string {
+	spoolName := sanitizeSpoolName(name)
+	if owner, ok := claimed[spoolName]; ok && owner != name {
+		disambiguated := fmt.Sprintf("%s-%08x", spoolName, fnv32(name))
+		log.Errorf("spool: stream %q sanitizes to %q, already claimed by stream %q; using %q instead", name, spoolName, owner, disambiguated)
+		spoolName = disambiguated
+	}
+	claimed[spoolName] = name
+	return spoolName
+}
+
+func fnv32(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
+
+// maxSegmentEvents is how many events accumulate in one spool segment before
+// it is rolled and made available to getBatch, for a queue created without a
+// positive max size; otherwise max_size (the flow's queue_size) is the limit.
+const maxSegmentEvents = 10000
+
+// spooledEvent is the on-disk, line-delimited JSON representation of a
+// logEvent.
+type spooledEvent struct {
+	Msg       string `json:"msg"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// eventQueue is a crash-durable buffer: every added event is appended to a
+// segment file under its flow's SpoolDir before it is considered queued, so
+// backpressure or a process exit never silently drops it. A segment is only
+// deleted once dst.upload of its batch has returned success; any other
+// result leaves it on disk to be retried.
+type eventQueue struct {
+	max_size int
+	dir      string
+
+	// flowName/streamName label the queueDepth/eventsDropped metrics; they
+	// identify this queue the same way its spool directory does.
+	flowName   string
+	streamName string
+
+	mu       sync.Mutex
+	segments []string   // closed segment paths awaiting upload, oldest first
+	inFlight string     // segment currently being drained by getBatch/commit
+	loaded   eventsList // full contents of inFlight, loaded once
+	pos      int        // index into loaded already committed
+	pending  int        // events (including dropped) in the batch getBatch last returned
+
+	current      *os.File
+	currentName  string
+	currentCount int
+	nextSeq      int
+
+	// dropped counts events rejected by buildBatch for falling outside the
+	// PutLogEvents accepted time window (too old or too far in the future).
+	dropped int64
+}
+
+func newEventQueue(dir string, maxSize int, flowName, streamName string) (*eventQueue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	q := &eventQueue{max_size: maxSize, dir: dir, flowName: flowName, streamName: streamName}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil || info.Size() == 0 {
+			continue
+		}
+		q.segments = append(q.segments, p)
+		if events, err := readSegment(p); err == nil {
+			queueDepth.WithLabelValues(flowName, streamName).Add(float64(len(events)))
+		}
+		if seq := seqOf(p); seq >= q.nextSeq {
+			q.nextSeq = seq + 1
+		}
+	}
+	if len(q.segments) > 0 {
+		log.Infof("spool %s: resuming %d segment(s) from a previous run", dir, len(q.segments))
+	}
+	return q, nil
+}
+
+func seqOf(path string) int {
+	n, _ := strconv.Atoi(strings.TrimSuffix(filepath.Base(path), ".seg"))
+	return n
+}
+
+func (q *eventQueue) add(events ...logEvent) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, e := range events {
+		if err := q.appendLocked(e); err != nil {
+			log.Errorf("spool %s: dropping event, append failed: %v", q.dir, err)
+			eventsDropped.WithLabelValues(q.flowName, "queue_full").Inc()
+			continue
+		}
+		queueDepth.WithLabelValues(q.flowName, q.streamName).Inc()
+		limit := q.max_size
+		if limit <= 0 {
+			limit = maxSegmentEvents
+		}
+		if q.currentCount >= limit {
+			q.rollCurrentLocked()
+		}
+	}
+}
+
+func (q *eventQueue) appendLocked(e logEvent) error {
+	if q.current == nil {
+		name := fmt.Sprintf("%020d.seg", q.nextSeq)
+		q.nextSeq++
+		f, err := os.OpenFile(filepath.Join(q.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		q.current = f
+		q.currentName = name
+	}
+	line, err := json.Marshal(spooledEvent{Msg: e.msg, Timestamp: e.timestamp})
+	if err != nil {
+		return err
+	}
+	if _, err := q.current.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	q.currentCount++
+	return q.current.Sync()
+}
+
+func (q *eventQueue) rollCurrentLocked() {
+	if q.current == nil || q.currentCount == 0 {
+		return
+	}
+	q.current.Close()
+	q.segments = append(q.segments, filepath.Join(q.dir, q.currentName))
+	q.current, q.currentName, q.currentCount = nil, "", 0
+}
+
+func (q *eventQueue) empty() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.inFlight == "" && len(q.segments) == 0 && q.currentCount == 0
+}
+
+// getBatch hands out a PutLogEvents-legal slice of the oldest segment
+// without removing anything: the caller must call commit once dst.upload
+// succeeds, otherwise the same slice is returned again on the next call.
+// A segment larger than one batch is drained across several getBatch/commit
+// rounds rather than all at once.
+func (q *eventQueue) getBatch() eventsList {
+	q.mu.Lock()
+	if q.inFlight == "" {
+		q.rollCurrentLocked()
+		if len(q.segments) == 0 {
+			q.mu.Unlock()
+			return nil
+		}
+		q.inFlight = q.segments[0]
+		loaded, err := readSegment(q.inFlight)
+		if err != nil {
+			log.Errorf("spool %s: reading %s: %v", q.dir, q.inFlight, err)
+			q.inFlight = ""
+			q.mu.Unlock()
+			return nil
+		}
+		// Sort once, up front, the same way buildBatch will: q.pos later
+		// indexes into q.loaded, so the two must agree on ordering or commit
+		// advances past the wrong events (see buildBatch's doc comment).
+		sort.Stable(loaded)
+		q.loaded = loaded
+		q.pos = 0
+	}
+	remaining := q.loaded[q.pos:]
+	q.mu.Unlock()
+
+	before := atomic.LoadInt64(&q.dropped)
+	batch, consumed := buildBatch(remaining, &q.dropped)
+	if dropped := atomic.LoadInt64(&q.dropped) - before; dropped > 0 {
+		eventsDropped.WithLabelValues(q.flowName, "too_old").Add(float64(dropped))
+	}
+	q.mu.Lock()
+	q.pending = consumed
+	q.mu.Unlock()
+	return batch
+}
+
+// commit advances past the events getBatch last handed out, deleting the
+// segment once it has been fully drained.
+func (q *eventQueue) commit() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.inFlight == "" {
+		return
+	}
+	queueDepth.WithLabelValues(q.flowName, q.streamName).Sub(float64(q.pending))
+	q.pos += q.pending
+	q.pending = 0
+	if q.pos < len(q.loaded) {
+		return
+	}
+	if err := os.Remove(q.inFlight); err != nil {
+		log.Errorf("spool %s: removing %s: %v", q.dir, q.inFlight, err)
+	}
+	if len(q.segments) > 0 && q.segments[0] == q.inFlight {
+		q.segments = q.segments[1:]
+	}
+	q.inFlight, q.loaded, q.pos = "", nil, 0
+}
+
+func readSegment(path string) (eventsList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var batch eventsList
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEventSize+1024)
+	for scanner.Scan() {
+		var se spooledEvent
+		// A trailing line can be partially written if the process died
+		// mid-append; skip it rather than fail the whole segment.
+		if err := json.Unmarshal(scanner.Bytes(), &se); err != nil {
+			continue
+		}
+		batch = append(batch, logEvent{msg: se.Msg, timestamp: se.Timestamp})
+	}
+	return batch, scanner.Err()
+}
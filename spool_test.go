@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestEventQueueRollAndResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := newEventQueue(dir, 2, "flow", "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.add(
+		logEvent{msg: "a", timestamp: 1},
+		logEvent{msg: "b", timestamp: 2},
+		logEvent{msg: "c", timestamp: 3},
+	)
+	if len(q.segments) != 1 {
+		t.Fatalf("expected 1 rolled segment once max_size was exceeded, got %d", len(q.segments))
+	}
+
+	resumed, err := newEventQueue(dir, 2, "flow", "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.empty() {
+		t.Fatal("a fresh queue over the same dir should see the previous run's segment(s)")
+	}
+}
+
+// TestEventQueueCommitOutOfOrderSegment guards against the buildBatch/commit
+// desync fixed in chunk0-3: a segment whose arrival order isn't timestamp
+// order (plausible over UDP, or with interleaved multiline flushes) used to
+// make commit advance past the wrong events once batched out of order.
+func TestEventQueueCommitOutOfOrderSegment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := newEventQueue(dir, 3, "flow", "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := nowMs()
+	q.add(
+		logEvent{msg: "second", timestamp: now + 2},
+		logEvent{msg: "first", timestamp: now + 1},
+		logEvent{msg: "third", timestamp: now + 3},
+	)
+
+	batch := q.getBatch()
+	if len(batch) != 3 {
+		t.Fatalf("expected all 3 events in one batch, got %d", len(batch))
+	}
+	if batch[0].msg != "first" || batch[1].msg != "second" || batch[2].msg != "third" {
+		t.Fatalf("batch not in ascending timestamp order: %+v", batch)
+	}
+
+	q.commit()
+	if !q.empty() {
+		t.Fatal("commit should have drained the only segment")
+	}
+}
+
+func TestEventQueueGetBatchEmpty(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := newEventQueue(dir, 10, "flow", "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch := q.getBatch(); batch != nil {
+		t.Fatalf("expected nil batch from an empty queue, got %+v", batch)
+	}
+}
+
+func TestSanitizeSpoolName(t *testing.T) {
+	cases := map[string]string{
+		"app":               "app",
+		"app/host":          "app_host",
+		"../../../tmp/evil": ".._.._.._tmp_evil",
+		"..":                "_",
+		".":                 "_",
+		"":                  "_",
+	}
+	for in, want := range cases {
+		if got := sanitizeSpoolName(in); got != want {
+			t.Errorf("sanitizeSpoolName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
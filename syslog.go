@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// parsedRecord is the result of running a syslogParser over one raw line.
+// Its exported fields are what flow.CloudwatchFormat templates render.
+type parsedRecord struct {
+	timestamp time.Time
+	Host      string
+	App       string
+	Procid    string
+	Severity  string
+	Facility  string
+	Message   string
+}
+
+func (p *parsedRecord) render(tpl *template.Template, buf *bytes.Buffer) error {
+	buf.Reset()
+	return tpl.Execute(buf, p)
+}
+
+// syslogParser turns one raw line read off a receiver into a parsedRecord.
+type syslogParser func(line string) (*parsedRecord, error)
+
+var parserFunctions = map[string]syslogParser{
+	"rfc3164": parseRFC3164,
+	"rfc5424": parseRFC5424,
+	"raw":     parseRaw,
+}
+
+// parseRaw treats the line as an already-unframed message, for receivers
+// (file, journald) that don't speak syslog. The timestamp is synthesized
+// from arrival time since there is no framing to carry one.
+func parseRaw(line string) (*parsedRecord, error) {
+	return &parsedRecord{timestamp: time.Now(), Message: line}, nil
+}
+
+var errUnparsableLine = fmt.Errorf("line does not match expected syslog format")
+
+// <134>Jun 14 15:16:01 host app[123]: message
+var rfc3164Pattern = regexp.MustCompile(`^<(\d+)>(\w{3}\s+\d{1,2}\s\d{2}:\d{2}:\d{2})\s(\S+)\s(\S+?)(?:\[(\d+)\])?:\s(.*)$`)
+
+func parseRFC3164(line string) (*parsedRecord, error) {
+	m := rfc3164Pattern.FindStringSubmatch(line)
+	if m == nil {
+		return nil, errUnparsableLine
+	}
+	pri, _ := strconv.Atoi(m[1])
+	ts, err := time.Parse("Jan _2 15:04:05", m[2])
+	if err != nil {
+		return nil, err
+	}
+	ts = ts.AddDate(time.Now().Year(), 0, 0)
+	return &parsedRecord{
+		timestamp: ts,
+		Severity:  strconv.Itoa(pri & 0x07),
+		Facility:  strconv.Itoa(pri >> 3),
+		Host:      m[3],
+		App:       m[4],
+		Procid:    m[5],
+		Message:   m[6],
+	}, nil
+}
+
+// <134>1 2016-06-14T15:16:01Z host app 123 - - message
+var rfc5424Pattern = regexp.MustCompile(`^<(\d+)>1\s(\S+)\s(\S+)\s(\S+)\s(\S+)\s(?:\S+)\s(?:\S+)\s(.*)$`)
+
+func parseRFC5424(line string) (*parsedRecord, error) {
+	m := rfc5424Pattern.FindStringSubmatch(line)
+	if m == nil {
+		return nil, errUnparsableLine
+	}
+	pri, _ := strconv.Atoi(m[1])
+	ts, err := time.Parse(time.RFC3339, m[2])
+	if err != nil {
+		return nil, err
+	}
+	return &parsedRecord{
+		timestamp: ts,
+		Severity:  strconv.Itoa(pri & 0x07),
+		Facility:  strconv.Itoa(pri >> 3),
+		Host:      m[3],
+		App:       m[4],
+		Procid:    m[5],
+		Message:   m[6],
+	}, nil
+}
@@ -0,0 +1,15 @@
+package main
+
+import "math/rand"
+
+const randomChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// RandomString returns a random alphanumeric string of length n, used in
+// tests to build oversized messages without committing large fixtures.
+func RandomString(n int) string {
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = randomChars[rand.Intn(len(randomChars))]
+	}
+	return string(out)
+}